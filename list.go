@@ -1,5 +1,7 @@
 package ps
 
+import "iter"
+
 type List interface {
     // IsNil returns true if the list is empty
     IsNil() bool
@@ -19,8 +21,17 @@ type List interface {
     // ForEach executes a callback for each value in the list
     ForEach(f func(Any))
 
+    // Iter returns a Seq over the list's values, head first, stopping
+    // as soon as the consumer of the Seq stops ranging.
+    Iter() iter.Seq[Any]
+
     // Reverse returns a list with elements in opposite order as this list
     Reverse() List
+
+    // AsTransient returns a mutable draft of this list, for building
+    // up a large list with the same Cons-based vocabulary. Call
+    // Persistent on the draft when done.
+    AsTransient() TransientList
 }
 
 // Immutable (i.e. persistent) list
@@ -79,9 +90,80 @@ func (self *list) ForEach(f func(Any)) {
     self.Tail().ForEach(f)
 }
 
+// Iter returns a Seq over self's values, head first.
+func (self *list) Iter() iter.Seq[Any] {
+    return func(yield func(Any) bool) {
+        for n := self; !n.IsNil(); n = n.tail {
+            if !yield(n.value) {
+                return
+            }
+        }
+    }
+}
+
 // Reverse returns a list with elements in opposite order as this list
 func (self *list) Reverse() List {
     reversed := NewList()
     self.ForEach( func (v Any) { reversed = reversed.Cons(v) })
     return reversed
 }
+
+// AsTransient returns a mutable draft of self.  Cons already runs in
+// O(1) without any copying, so TransientList is a thin wrapper: it
+// exists so callers can build up a list with the same batch-mutation
+// vocabulary as TransientMap.
+func (self *list) AsTransient() TransientList {
+    return TransientList{current: self}
+}
+
+// TransientList is a mutable draft of a List.  Call Persistent to
+// turn the draft back into an immutable List; using a TransientList
+// afterwards panics.
+type TransientList struct {
+    current *list
+    done    bool
+}
+
+func (t *TransientList) checkLive() {
+    if t.done {
+        panic("ps: TransientList used after Persistent()")
+    }
+}
+
+// Cons adds val onto the head of the draft, in place.
+func (t *TransientList) Cons(val Any) {
+    t.checkLive()
+    t.current = t.current.Cons(val).(*list)
+}
+
+// Head returns the first element in the draft or panics if it's empty.
+func (t *TransientList) Head() Any {
+    t.checkLive()
+    return t.current.Head()
+}
+
+// Tail returns the tail of the draft or panics if it's empty.
+func (t *TransientList) Tail() List {
+    t.checkLive()
+    return t.current.Tail()
+}
+
+// Size returns the draft's current length.
+func (t *TransientList) Size() int {
+    t.checkLive()
+    return t.current.Size()
+}
+
+// ForEach executes a callback for each value currently in the draft.
+func (t *TransientList) ForEach(f func(Any)) {
+    t.checkLive()
+    t.current.ForEach(f)
+}
+
+// Persistent finalizes the draft and returns an immutable List.  The
+// TransientList must not be used after calling Persistent.
+func (t *TransientList) Persistent() List {
+    t.checkLive()
+    t.done = true
+    return t.current
+}
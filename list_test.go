@@ -0,0 +1,82 @@
+package ps
+
+import "testing"
+
+// TestTransientListRoundTrip checks that editing a draft never
+// mutates the source list and that every edit made through the draft
+// shows up in the List returned by Persistent.
+func TestTransientListRoundTrip(t *testing.T) {
+    base := NewList().Cons(2).Cons(1)
+
+    draft := base.AsTransient()
+    draft.Cons(0)
+    out := draft.Persistent()
+
+    if size := base.Size(); size != 2 {
+        t.Errorf("source list was mutated: size %d", size)
+    }
+    if v := base.Head(); v != 1 {
+        t.Errorf("source list's head changed: %v", v)
+    }
+
+    if size := out.Size(); size != 3 {
+        t.Errorf("wrong size after Persistent(): %d", size)
+    }
+    if v := out.Head(); v != 0 {
+        t.Errorf("missing or wrong head value: %v", v)
+    }
+    if v := out.Tail().Head(); v != 1 {
+        t.Errorf("wrong value after head: %v", v)
+    }
+}
+
+// TestTransientListIndependence confirms that two transients drafted
+// from the same source don't leak edits into each other or into the
+// source list.
+func TestTransientListIndependence(t *testing.T) {
+    base := NewList().Cons(2).Cons(1)
+
+    d1 := base.AsTransient()
+    d2 := base.AsTransient()
+    d1.Cons("from-d1")
+    d2.Cons("from-d2")
+
+    out1 := d1.Persistent()
+    out2 := d2.Persistent()
+
+    if v := out1.Head(); v != "from-d1" {
+        t.Errorf("d1's edit was lost or overwritten: %v", v)
+    }
+    if v := out2.Head(); v != "from-d2" {
+        t.Errorf("d2's edit was lost or overwritten: %v", v)
+    }
+    if v := base.Head(); v != 1 {
+        t.Errorf("source list was mutated by a transient: %v", v)
+    }
+}
+
+// TestTransientListUseAfterPersistent checks that Cons/Head/Tail/
+// Size/ForEach all refuse to operate on a draft once it's been
+// finalized.
+func TestTransientListUseAfterPersistent(t *testing.T) {
+    draft := NewList().Cons(1).AsTransient()
+    draft.Persistent()
+
+    calls := map[string]func(){
+        "Cons":    func() { draft.Cons(2) },
+        "Head":    func() { draft.Head() },
+        "Tail":    func() { draft.Tail() },
+        "Size":    func() { draft.Size() },
+        "ForEach": func() { draft.ForEach(func(Any) {}) },
+    }
+    for name, call := range calls {
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf("%s on a finalized TransientList should panic", name)
+                }
+            }()
+            call()
+        }()
+    }
+}
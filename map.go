@@ -13,6 +13,8 @@ import . "fmt"
 
 import "bytes"
 import "hash/fnv"
+import "iter"
+import "math/bits"
 
 // Any is a shorthand for Go's verbose interface{} type.
 type Any interface{}
@@ -25,16 +27,16 @@ type Map interface {
     // Set returns a new map in which key and value are associated.
     // If the key didn't exist before, it's created; otherwise, the
     // associated value is changed.
-    // This operation is O(log N) in the number of keys.
+    // This operation is O(log32 N) in the number of keys.
     Set(key string, value Any) Map
 
     // Delete returns a new map with the association for key, if any, removed.
-    // This operation is O(log N) in the number of keys.
+    // This operation is O(log32 N) in the number of keys.
     Delete(key string) Map
 
     // Lookup returns the value associated with a key, if any.  If the key
     // exists, the second return value is true; otherwise, false.
-    // This operation is O(log N) in the number of keys.
+    // This operation is O(log32 N) in the number of keys.
     Lookup(key string) (Any, bool)
 
     // Size returns the number of key value pairs in the map.
@@ -48,50 +50,106 @@ type Map interface {
     // This operation is O(N) in the number of keys.
     Keys() []string
 
+    // Iter returns a Seq2 over every key/value pair in the map, in
+    // the trie's own (hash) order.  Ranging stops as soon as the
+    // consumer of the Seq2 stops ranging.
+    Iter() iter.Seq2[string, Any]
+
+    // Merge returns a new map holding every key from this map and
+    // other.  Keys present in both are resolved by calling resolve
+    // with the key and each map's value.
+    Merge(other Map, resolve func(key string, a, b Any) Any) Map
+
+    // AsTransient returns a mutable draft of this map, for building
+    // up a large map without a path-copy on every Set or Delete.
+    // Call Persistent on the draft when done.
+    AsTransient() TransientMap
+
     String() string
 }
 
-// Immutable (i.e. persistent) associative array
-type tree struct {
-    count   int
-    hash    uint64  // hash of the key (used for tree balancing)
-    key     string
-    value   Any
-    left    *tree
-    right   *tree
+// chunkBits is the number of hash bits consumed at each level of the
+// trie, giving each branch node a fanout of 32.
+const chunkBits = 5
+const chunkMask = 1<<chunkBits - 1
+
+// hamt is a persistent Hash Array Mapped Trie.  It implements Map by
+// pairing the trie's root node with the map's size, so Size() stays
+// O(1) instead of walking the whole trie.
+type hamt struct {
+    count int
+    root  node
+}
+var nilMap = &hamt{}
+
+// node is a single node of the trie.  It's one of *branch, *leaf or
+// *collision.  A nil node represents an empty subtree.
+type node interface {
+    lookup(hash uint64, shift uint, key string) (Any, bool)
+    set(hash uint64, shift uint, key string, value Any) (node, bool)
+    delete(hash uint64, shift uint, key string) (node, bool)
+    forEach(f func(key string, val Any))
+
+    // mutableSet and mutableDelete are the transient counterparts of
+    // set and delete: a branch already owned by owner is edited in
+    // place; every other node is path-copied and, if it's a branch,
+    // tagged with owner so later edits within the same transient can
+    // reuse it.
+    mutableSet(hash uint64, shift uint, key string, value Any, owner *token) (node, bool)
+    mutableDelete(hash uint64, shift uint, key string, owner *token) (node, bool)
+
+    // iterate calls yield for every key/value pair reachable from
+    // this node, stopping and returning false as soon as yield does.
+    iterate(yield func(key string, val Any) bool) bool
 }
-var nilMap = &tree{}
 
-// Recursively set nilMap's subtrees to point at itself.
-// This eliminates all nil pointers in the map structure.
-// All map nodes are created by cloning this structure so
-// they avoid the problem too.
-func init () {
-    nilMap.left = nilMap
-    nilMap.right = nilMap
+// branch is an interior trie node.  bitmap has a set bit for every
+// populated child; children holds only those children, compacted and
+// ordered so that the child for bit i lives at index
+// popcount(bitmap & (1<<i - 1)).
+type branch struct {
+    bitmap   uint32
+    children []node
+    owner    *token // non-nil while a transient may still mutate this node in place
+}
+
+// token distinguishes the nodes owned by one TransientMap from
+// everybody else's.  Only a branch tagged with a transient's own
+// token may be mutated in place by that transient; every other node
+// is path-copied and tagged on first touch, exactly as Set does.
+type token struct{}
+
+// leaf holds a single key/value pair together with the key's hash, so
+// nodes never need to recompute it while descending the trie.
+type leaf struct {
+    hash  uint64
+    key   string
+    value Any
+}
+
+// collisionEntry is one key/value pair inside a collision node.
+type collisionEntry struct {
+    key   string
+    value Any
+}
+
+// collision holds every key that shares the same hash once the trie has
+// consumed all of the hash's bits.  Its entries are compared by string
+// equality instead of by hash.
+type collision struct {
+    hash    uint64
+    entries []collisionEntry
 }
 
 // NewMap allocates a new, persistent map from strings to values of
 // any type.
-// This is currently implemented as a path-copying binary tree.
+// This is currently implemented as a Hash Array Mapped Trie (HAMT).
 func NewMap() Map {
     return nilMap
 }
 
-func (self *tree) IsNil() bool {
-    return self == nilMap
-}
-
-// clone returns an exact duplicate of a tree node
-func (self *tree) clone() *tree {
-    var m tree
-    m.count = self.count
-    m.hash  = self.hash
-    m.key   = self.key
-    m.value = self.value
-    m.left  = self.left
-    m.right = self.right
-    return &m
+func (self *hamt) IsNil() bool {
+    return self.count == 0
 }
 
 // hashKey returns a hash code for a given string
@@ -101,226 +159,381 @@ func hashKey(key string) uint64 {
     return hasher.Sum64()
 }
 
+// chunkIndex extracts the chunkBits-wide slice of hash that's relevant
+// at the given trie depth (shift = depth * chunkBits).
+func chunkIndex(hash uint64, shift uint) uint32 {
+    return uint32(hash>>shift) & chunkMask
+}
+
+// childIndex returns the position within a branch's compacted children
+// slice that corresponds to bit.
+func childIndex(bitmap, bit uint32) int {
+    return bits.OnesCount32(bitmap & (bit - 1))
+}
+
 // Set returns a new map similar to this one but with key and value
 // associated.  If the key didn't exist, it's created; otherwise, the
 // associated value is changed.
-func (self *tree) Set(key string, value Any) Map {
+func (self *hamt) Set(key string, value Any) Map {
     hash := hashKey(key)
-    return setLowLevel(self, hash, key, value)
+    newRoot, isNewKey := setNode(self.root, hash, 0, key, value)
+    count := self.count
+    if isNewKey {
+        count++
+    }
+    return &hamt{count: count, root: newRoot}
 }
 
-func setLowLevel(self *tree, hash uint64, key string, value Any) *tree {
-    if self.IsNil() { // an empty tree is easy
-        m := self.clone()
-        m.count = 1
-        m.hash  = hash
-        m.key   = key
-        m.value = value
-        return m
+func setNode(self node, hash uint64, shift uint, key string, value Any) (node, bool) {
+    if self == nil {
+        return &leaf{hash: hash, key: key, value: value}, true
     }
+    return self.set(hash, shift, key, value)
+}
 
-    if hash < self.hash { // insert into left subtree
-        m := self.clone()
-        m.left = setLowLevel(self.left, hash, key, value)
-        recalculateCount(m)
-        return m
-    }
-    if hash > self.hash { // insert into right subtree
-        m := self.clone()
-        m.right = setLowLevel(self.right, hash, key, value)
-        recalculateCount(m)
-        return m
+func (self *leaf) set(hash uint64, shift uint, key string, value Any) (node, bool) {
+    if hash == self.hash {
+        if key == self.key {
+            return &leaf{hash: hash, key: key, value: value}, false
+        }
+        entries := []collisionEntry{{self.key, self.value}, {key, value}}
+        return &collision{hash: hash, entries: entries}, true
     }
-
-    // replacing a key's previous value
-    m := self.clone()
-    m.value = value
-    return m
+    return mergeLeaves(self.hash, self, hash, &leaf{hash: hash, key: key, value: value}, shift, nil), true
 }
 
-// modifies a map by recalculating its key count based on the counts
-// of its subtrees
-func recalculateCount(m *tree) {
-    count := 0
-    if !m.left.IsNil() {
-        count += m.left.Size()
+func (self *collision) set(hash uint64, shift uint, key string, value Any) (node, bool) {
+    if hash != self.hash {
+        newLeaf := &leaf{hash: hash, key: key, value: value}
+        return mergeLeaves(self.hash, self, hash, newLeaf, shift, nil), true
     }
-    if !m.right.IsNil() {
-        count += m.right.Size()
+
+    for i, entry := range self.entries {
+        if entry.key == key {
+            entries := make([]collisionEntry, len(self.entries))
+            copy(entries, self.entries)
+            entries[i].value = value
+            return &collision{hash: hash, entries: entries}, false
+        }
     }
-    m.count = count + 1 // add one to count ourself
-}
 
-func (m *tree) Delete(key string) Map {
-    hash := hashKey(key)
-    newMap, _ := deleteLowLevel(m, hash)
-    return newMap
+    entries := make([]collisionEntry, len(self.entries)+1)
+    copy(entries, self.entries)
+    entries[len(self.entries)] = collisionEntry{key, value}
+    return &collision{hash: hash, entries: entries}, true
 }
 
-func deleteLowLevel(self *tree, hash uint64) (*tree, bool) {
-    // empty trees are easy
-    if self.IsNil() {
-        return self, false
+func (self *branch) set(hash uint64, shift uint, key string, value Any) (node, bool) {
+    bit := uint32(1) << chunkIndex(hash, shift)
+    pos := childIndex(self.bitmap, bit)
+
+    if self.bitmap&bit == 0 { // no existing child in this slot
+        children := make([]node, len(self.children)+1)
+        copy(children, self.children[:pos])
+        children[pos] = &leaf{hash: hash, key: key, value: value}
+        copy(children[pos+1:], self.children[pos:])
+        return &branch{bitmap: self.bitmap | bit, children: children}, true
     }
 
-    if hash < self.hash { // look in the left subtree
-        newLeft, found := deleteLowLevel(self.left, hash)
-        if !found {
-            return self, false
-        }
-        newMap := self.clone()
-        newMap.left = newLeft
-        recalculateCount(newMap)
-    }
-    if hash > self.hash { // look in the right subtree
-        newRight, found := deleteLowLevel(self.right, hash)
-        if !found {
-            return self, false
+    newChild, isNewKey := setNode(self.children[pos], hash, shift+chunkBits, key, value)
+    children := make([]node, len(self.children))
+    copy(children, self.children)
+    children[pos] = newChild
+    return &branch{bitmap: self.bitmap, children: children}, isNewKey
+}
+
+func (self *leaf) mutableSet(hash uint64, shift uint, key string, value Any, owner *token) (node, bool) {
+    if hash == self.hash {
+        if key == self.key {
+            return &leaf{hash: hash, key: key, value: value}, false
         }
-        newMap := self.clone()
-        newMap.right = newRight
-        recalculateCount(newMap)
+        entries := []collisionEntry{{self.key, self.value}, {key, value}}
+        return &collision{hash: hash, entries: entries}, true
     }
+    return mergeLeaves(self.hash, self, hash, &leaf{hash: hash, key: key, value: value}, shift, owner), true
+}
 
-    // we must delete our own node
-    if self.isLeaf() {  // we have no children
-        return nilMap, true
+func (self *collision) mutableSet(hash uint64, shift uint, key string, value Any, owner *token) (node, bool) {
+    if hash != self.hash {
+        newLeaf := &leaf{hash: hash, key: key, value: value}
+        return mergeLeaves(self.hash, self, hash, newLeaf, shift, owner), true
     }
-    if self.subtreeCount() == 1 { // only one subtree
-        if self.hasLeft() {  // it's the left one
-            return self.left, true
+
+    for i, entry := range self.entries {
+        if entry.key == key {
+            entries := make([]collisionEntry, len(self.entries))
+            copy(entries, self.entries)
+            entries[i].value = value
+            return &collision{hash: hash, entries: entries}, false
         }
-        return self.right, true  // it's the right one
     }
 
-    // find a node to replace us
-    if self.left.Size() > self.right.Size() {  // make left side smaller
-        replacement, newLeft := self.left.deleteRightmost()
-        newMap := replacement.clone()
-        newMap.left = newLeft
-        newMap.right = self.right
-        recalculateCount(newMap)
-        return newMap, true
+    entries := make([]collisionEntry, len(self.entries)+1)
+    copy(entries, self.entries)
+    entries[len(self.entries)] = collisionEntry{key, value}
+    return &collision{hash: hash, entries: entries}, true
+}
+
+// mutableSet edits self in place when it's already owned by owner;
+// otherwise it clones self (path-copying, as set does) and tags the
+// clone with owner so a later edit within the same transient can
+// reuse it directly.
+func (self *branch) mutableSet(hash uint64, shift uint, key string, value Any, owner *token) (node, bool) {
+    bit := uint32(1) << chunkIndex(hash, shift)
+    pos := childIndex(self.bitmap, bit)
+
+    target := self
+    if self.owner != owner {
+        target = &branch{bitmap: self.bitmap, owner: owner, children: append([]node(nil), self.children...)}
+    }
+
+    if self.bitmap&bit == 0 { // no existing child in this slot
+        children := make([]node, len(target.children)+1)
+        copy(children, target.children[:pos])
+        children[pos] = &leaf{hash: hash, key: key, value: value}
+        copy(children[pos+1:], target.children[pos:])
+        target.bitmap |= bit
+        target.children = children
+        return target, true
     }
 
-    // make right side smaller
-    replacement, newRight := self.right.deleteLeftmost()
-    newMap := replacement.clone()
-    newMap.right = newRight
-    newMap.left = self.left
-    recalculateCount(newMap)
-    return newMap, true
+    newChild, isNewKey := self.children[pos].mutableSet(hash, shift+chunkBits, key, value, owner)
+    target.children[pos] = newChild
+    return target, isNewKey
 }
 
-// delete the left or rightmost node in a tree returning the node that
-// was deleted and the tree left over after its deletion
-func (m *tree) deleteRightmost() (*tree, *tree) {
-    if m.isLeaf() {
-        return m, nilMap
+// mergeLeaves builds the smallest chain of branch nodes needed to keep
+// oldNode (found under oldHash) and newNode (found under newHash)
+// apart.  It's used whenever a leaf or collision node needs to make
+// room for a key whose hash differs from its own.  owner is nil for
+// an ordinary (persistent) Set and tags the resulting branches for a
+// transient's use otherwise.
+func mergeLeaves(oldHash uint64, oldNode node, newHash uint64, newNode node, shift uint, owner *token) node {
+    oldIdx := chunkIndex(oldHash, shift)
+    newIdx := chunkIndex(newHash, shift)
+
+    if oldIdx == newIdx {
+        child := mergeLeaves(oldHash, oldNode, newHash, newNode, shift+chunkBits, owner)
+        return &branch{bitmap: uint32(1) << oldIdx, children: []node{child}, owner: owner}
     }
-    if m.hasRight() {
-        deleted, newRight := m.right.deleteRightmost()
-        newMap := m.clone()
-        newMap.right = newRight
-        recalculateCount(newMap)
-        return deleted, newMap
+
+    bitmap := uint32(1)<<oldIdx | uint32(1)<<newIdx
+    if oldIdx < newIdx {
+        return &branch{bitmap: bitmap, children: []node{oldNode, newNode}, owner: owner}
     }
+    return &branch{bitmap: bitmap, children: []node{newNode, oldNode}, owner: owner}
+}
 
-    deleted := m.clone()
-    deleted.left = nilMap
-    return deleted, m.left
+func (self *hamt) Delete(key string) Map {
+    hash := hashKey(key)
+    if self.root == nil {
+        return self
+    }
+    newRoot, found := self.root.delete(hash, 0, key)
+    if !found {
+        return self
+    }
+    return &hamt{count: self.count - 1, root: newRoot}
 }
-func (m *tree) deleteLeftmost() (*tree, *tree) {
-    if m.isLeaf() {
-        return m, nilMap
+
+func (self *leaf) delete(hash uint64, shift uint, key string) (node, bool) {
+    if hash != self.hash || key != self.key {
+        return self, false
     }
-    if m.hasLeft() {
-        deleted, newLeft := m.left.deleteLeftmost()
-        newMap := m.clone()
-        newMap.left = newLeft
-        recalculateCount(newMap)
-        return deleted, newMap
+    return nil, true
+}
+
+func (self *collision) delete(hash uint64, shift uint, key string) (node, bool) {
+    if hash != self.hash {
+        return self, false
     }
 
-    deleted := m.clone()
-    deleted.count = 1
-    deleted.right = nilMap
-    return deleted, m.right
+    for i, entry := range self.entries {
+        if entry.key != key {
+            continue
+        }
+        if len(self.entries) == 2 {
+            survivor := self.entries[1-i]
+            return &leaf{hash: hash, key: survivor.key, value: survivor.value}, true
+        }
+        entries := make([]collisionEntry, 0, len(self.entries)-1)
+        entries = append(entries, self.entries[:i]...)
+        entries = append(entries, self.entries[i+1:]...)
+        return &collision{hash: hash, entries: entries}, true
+    }
+    return self, false
 }
 
-// hasLeft and hasRight return true if this tree has a left or right subtree
-func (m *tree) hasLeft() bool {
-    return !m.left.IsNil()
+func (self *branch) delete(hash uint64, shift uint, key string) (node, bool) {
+    bit := uint32(1) << chunkIndex(hash, shift)
+    if self.bitmap&bit == 0 {
+        return self, false
+    }
+    pos := childIndex(self.bitmap, bit)
+
+    newChild, found := self.children[pos].delete(hash, shift+chunkBits, key)
+    if !found {
+        return self, false
+    }
+
+    if newChild == nil {
+        if len(self.children) == 1 {
+            return nil, true
+        }
+        children := make([]node, len(self.children)-1)
+        copy(children, self.children[:pos])
+        copy(children[pos:], self.children[pos+1:])
+        return &branch{bitmap: self.bitmap &^ bit, children: children}, true
+    }
+
+    children := make([]node, len(self.children))
+    copy(children, self.children)
+    children[pos] = newChild
+    return &branch{bitmap: self.bitmap, children: children}, true
 }
-func (m *tree) hasRight() bool {
-    return !m.right.IsNil()
+
+func (self *leaf) mutableDelete(hash uint64, shift uint, key string, owner *token) (node, bool) {
+    return self.delete(hash, shift, key)
 }
 
-// isLeaf returns true if this is a leaf node
-func (m *tree) isLeaf() bool {
-    return m.Size() == 1
+func (self *collision) mutableDelete(hash uint64, shift uint, key string, owner *token) (node, bool) {
+    return self.delete(hash, shift, key)
 }
 
-// returns the number of child subtrees we have
-func (m *tree) subtreeCount() int {
-    count := 0
-    if m.hasLeft() {
-        count++
+// mutableDelete edits self in place when it's already owned by
+// owner; otherwise it clones self and tags the clone with owner, just
+// like mutableSet.
+func (self *branch) mutableDelete(hash uint64, shift uint, key string, owner *token) (node, bool) {
+    bit := uint32(1) << chunkIndex(hash, shift)
+    if self.bitmap&bit == 0 {
+        return self, false
     }
-    if m.hasRight() {
-        count++
+    pos := childIndex(self.bitmap, bit)
+
+    newChild, found := self.children[pos].mutableDelete(hash, shift+chunkBits, key, owner)
+    if !found {
+        return self, false
     }
-    return count
-}
 
-func (m *tree) Lookup(key string) (Any, bool) {
-    hash := hashKey(key)
-    return lookupLowLevel(m, hash)
+    target := self
+    if self.owner != owner {
+        target = &branch{bitmap: self.bitmap, owner: owner, children: append([]node(nil), self.children...)}
+    }
+
+    if newChild == nil {
+        if len(target.children) == 1 {
+            return nil, true
+        }
+        children := make([]node, len(target.children)-1)
+        copy(children, target.children[:pos])
+        copy(children[pos:], target.children[pos+1:])
+        target.bitmap &^= bit
+        target.children = children
+        return target, true
+    }
+
+    target.children[pos] = newChild
+    return target, true
 }
 
-func lookupLowLevel(self *tree, hash uint64) (Any, bool) {
-    if self.IsNil() { // an empty tree is easy
+func (self *hamt) Lookup(key string) (Any, bool) {
+    if self.root == nil {
         return nil, false
     }
+    return self.root.lookup(hashKey(key), 0, key)
+}
 
-    if hash < self.hash { // look in the left subtree
-        return lookupLowLevel(self.left, hash)
+func (self *leaf) lookup(hash uint64, shift uint, key string) (Any, bool) {
+    if hash == self.hash && key == self.key {
+        return self.value, true
     }
-    if hash > self.hash { // look in the right subtree
-        return lookupLowLevel(self.right, hash)
+    return nil, false
+}
+
+func (self *collision) lookup(hash uint64, shift uint, key string) (Any, bool) {
+    if hash != self.hash {
+        return nil, false
     }
+    for _, entry := range self.entries {
+        if entry.key == key {
+            return entry.value, true
+        }
+    }
+    return nil, false
+}
 
-    // we found it
-    return self.value, true
+func (self *branch) lookup(hash uint64, shift uint, key string) (Any, bool) {
+    bit := uint32(1) << chunkIndex(hash, shift)
+    if self.bitmap&bit == 0 {
+        return nil, false
+    }
+    pos := childIndex(self.bitmap, bit)
+    return self.children[pos].lookup(hash, shift+chunkBits, key)
 }
 
-func (m *tree) Size() int {
-    return m.count
+func (self *hamt) Size() int {
+    return self.count
 }
 
-func (m *tree) ForEach(f func(key string, val Any)) {
-    if m.IsNil() {
+func (self *hamt) ForEach(f func(key string, val Any)) {
+    if self.root == nil {
         return
     }
+    self.root.forEach(f)
+}
+
+func (self *leaf) forEach(f func(key string, val Any)) {
+    f(self.key, self.value)
+}
 
-    // left branch
-    if !m.left.IsNil() {
-        m.left.ForEach(f)
+func (self *collision) forEach(f func(key string, val Any)) {
+    for _, entry := range self.entries {
+        f(entry.key, entry.value)
     }
+}
+
+func (self *branch) forEach(f func(key string, val Any)) {
+    for _, child := range self.children {
+        child.forEach(f)
+    }
+}
+
+// Iter returns a Seq2 over every key/value pair in m, in the trie's
+// own (hash) order.
+func (self *hamt) Iter() iter.Seq2[string, Any] {
+    return func(yield func(string, Any) bool) {
+        if self.root != nil {
+            self.root.iterate(yield)
+        }
+    }
+}
 
-    // ourself
-    f(m.key, m.value)
+func (self *leaf) iterate(yield func(key string, val Any) bool) bool {
+    return yield(self.key, self.value)
+}
+
+func (self *collision) iterate(yield func(key string, val Any) bool) bool {
+    for _, entry := range self.entries {
+        if !yield(entry.key, entry.value) {
+            return false
+        }
+    }
+    return true
+}
 
-    // right branch
-    if !m.right.IsNil() {
-        m.right.ForEach(f)
+func (self *branch) iterate(yield func(key string, val Any) bool) bool {
+    for _, child := range self.children {
+        if !child.iterate(yield) {
+            return false
+        }
     }
+    return true
 }
 
-func (m *tree) Keys() []string {
-    keys := make([]string, m.Size())
+func (self *hamt) Keys() []string {
+    keys := make([]string, self.Size())
     i := 0
-    m.ForEach( func (k string, v Any) {
+    self.ForEach( func (k string, v Any) {
         keys[i] = k
         i++
     })
@@ -328,13 +541,119 @@ func (m *tree) Keys() []string {
 }
 
 // make it easier to display maps for debugging
-func (m *tree) String() string {
-    keys := m.Keys()
+func (self *hamt) String() string {
+    keys := self.Keys()
     buf := bytes.NewBufferString("{")
     for _, key := range keys {
-        val, _ := m.Lookup(key)
+        val, _ := self.Lookup(key)
         Fprintf(buf, "%s: %s, ", key, val)
     }
     Fprintf(buf, "}\n")
     return buf.String()
 }
+
+// Merge returns a new map holding every key from self and other.
+// Keys present in both are resolved by calling resolve with the key,
+// self's value and other's value; its result becomes the merged
+// value.
+func (self *hamt) Merge(other Map, resolve func(key string, a, b Any) Any) Map {
+    t := self.AsTransient()
+    other.ForEach(func(key string, b Any) {
+        if a, found := t.Lookup(key); found {
+            t.Set(key, resolve(key, a, b))
+        } else {
+            t.Set(key, b)
+        }
+    })
+    return t.Persistent()
+}
+
+// FromMap creates a persistent Map holding the same associations as m.
+func FromMap(m map[string]Any) Map {
+    t := NewMap().AsTransient()
+    for key, value := range m {
+        t.Set(key, value)
+    }
+    return t.Persistent()
+}
+
+func mutableSetNode(self node, hash uint64, shift uint, key string, value Any, owner *token) (node, bool) {
+    if self == nil {
+        return &leaf{hash: hash, key: key, value: value}, true
+    }
+    return self.mutableSet(hash, shift, key, value, owner)
+}
+
+func mutableDeleteNode(self node, hash uint64, shift uint, key string, owner *token) (node, bool) {
+    if self == nil {
+        return nil, false
+    }
+    return self.mutableDelete(hash, shift, key, owner)
+}
+
+// TransientMap is a mutable draft of a Map.  It offers the same
+// Set/Delete/Lookup vocabulary as Map, but edits nodes in place when
+// it safely can instead of path-copying on every call.  Call
+// Persistent to turn the draft back into an immutable Map; using a
+// TransientMap afterwards panics.
+type TransientMap struct {
+    owner *token
+    count int
+    root  node
+    done  bool
+}
+
+// AsTransient returns a mutable draft of m.  m itself is untouched;
+// the draft clones only the nodes it actually needs to change.
+func (self *hamt) AsTransient() TransientMap {
+    return TransientMap{owner: new(token), count: self.count, root: self.root}
+}
+
+func (t *TransientMap) checkLive() {
+    if t.done {
+        panic("ps: TransientMap used after Persistent()")
+    }
+}
+
+// Set associates key with value in the draft, in place.
+func (t *TransientMap) Set(key string, value Any) {
+    t.checkLive()
+    newRoot, isNewKey := mutableSetNode(t.root, hashKey(key), 0, key, value, t.owner)
+    if isNewKey {
+        t.count++
+    }
+    t.root = newRoot
+}
+
+// Delete removes key's association from the draft, in place, if any.
+func (t *TransientMap) Delete(key string) {
+    t.checkLive()
+    newRoot, found := mutableDeleteNode(t.root, hashKey(key), 0, key, t.owner)
+    if found {
+        t.count--
+        t.root = newRoot
+    }
+}
+
+// Lookup returns the value associated with key in the draft, if any.
+func (t *TransientMap) Lookup(key string) (Any, bool) {
+    t.checkLive()
+    if t.root == nil {
+        return nil, false
+    }
+    return t.root.lookup(hashKey(key), 0, key)
+}
+
+// Size returns the number of key value pairs currently in the draft.
+func (t *TransientMap) Size() int {
+    t.checkLive()
+    return t.count
+}
+
+// Persistent finalizes the draft and returns an immutable Map.  The
+// TransientMap must not be used after calling Persistent.
+func (t *TransientMap) Persistent() Map {
+    t.checkLive()
+    t.done = true
+    return &hamt{count: t.count, root: t.root}
+}
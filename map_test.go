@@ -2,6 +2,7 @@ package ps
 
 import "testing"
 import "sort"
+import "fmt"
 
 func TestMapImmutable(t *testing.T) {
     // build a couple small maps
@@ -94,6 +95,288 @@ func TestMapMultipleKeys(t *testing.T) {
     }
 }
 
+func TestMapIter(t *testing.T) {
+    m := NewMap().Set("one", 1).Set("two", 2).Set("three", 3)
+
+    // Iter visits every association
+    seen := make(map[string]Any)
+    for k, v := range m.Iter() {
+        seen[k] = v
+    }
+    if len(seen) != 3 || seen["one"] != 1 || seen["two"] != 2 || seen["three"] != 3 {
+        t.Errorf("Iter() didn't visit every association: %#v", seen)
+    }
+
+    // Iter stops as soon as the consumer stops ranging
+    count := 0
+    for range m.Iter() {
+        count++
+        break
+    }
+    if count != 1 {
+        t.Errorf("Iter() didn't stop early: visited %d entries", count)
+    }
+}
+
+// TestMapManyKeys inserts and deletes enough keys that the trie grows
+// several branch levels deep, exercising childIndex/branch.set/
+// branch.delete well beyond the single-leaf case.
+func TestMapManyKeys(t *testing.T) {
+    const n = 200
+    m := NewMap()
+    for i := 0; i < n; i++ {
+        m = m.Set(fmt.Sprintf("key-%d", i), i)
+    }
+    if size := m.Size(); size != n {
+        t.Fatalf("wrong size after inserting %d keys: %d", n, size)
+    }
+    for i := 0; i < n; i++ {
+        key := fmt.Sprintf("key-%d", i)
+        if v, ok := m.Lookup(key); !ok || v != i {
+            t.Errorf("wrong value for %s: %v, found=%v", key, v, ok)
+        }
+    }
+
+    want := make([]string, n)
+    for i := 0; i < n; i++ {
+        want[i] = fmt.Sprintf("key-%d", i)
+    }
+    sort.Strings(want)
+    got := m.Keys()
+    sort.Strings(got)
+    if len(got) != len(want) {
+        t.Fatalf("wrong number of keys: got %d, want %d", len(got), len(want))
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Errorf("Keys() mismatch at %d: got %s, want %s", i, got[i], want[i])
+        }
+    }
+
+    // delete every other key, forcing branch collapses at several
+    // levels of the trie
+    for i := 0; i < n; i += 2 {
+        m = m.Delete(fmt.Sprintf("key-%d", i))
+    }
+    if size := m.Size(); size != n/2 {
+        t.Fatalf("wrong size after deleting half the keys: %d", size)
+    }
+    for i := 0; i < n; i++ {
+        key := fmt.Sprintf("key-%d", i)
+        _, ok := m.Lookup(key)
+        switch {
+        case i%2 == 0 && ok:
+            t.Errorf("%s should have been deleted", key)
+        case i%2 == 1 && !ok:
+            t.Errorf("%s should still be present", key)
+        }
+    }
+}
+
+// TestMapCollision exercises the collision-bucket path directly, by
+// driving the node interface with a hash the test controls instead of
+// relying on finding two strings that really collide under fnv64.
+func TestMapCollision(t *testing.T) {
+    const hash = uint64(42)
+    var n node = &leaf{hash: hash, key: "a", value: 1}
+
+    n, isNewKey := n.set(hash, 0, "b", 2)
+    if !isNewKey {
+        t.Fatalf("adding a colliding key should report isNewKey")
+    }
+    c, ok := n.(*collision)
+    if !ok {
+        t.Fatalf("expected a *collision node, got %T", n)
+    }
+    if len(c.entries) != 2 {
+        t.Fatalf("expected 2 entries in the collision bucket, got %d", len(c.entries))
+    }
+
+    if v, found := n.lookup(hash, 0, "a"); !found || v != 1 {
+        t.Errorf("wrong value for a: %v, found=%v", v, found)
+    }
+    if v, found := n.lookup(hash, 0, "b"); !found || v != 2 {
+        t.Errorf("wrong value for b: %v, found=%v", v, found)
+    }
+
+    // updating a key already in the bucket isn't a new key
+    n, isNewKey = n.set(hash, 0, "a", 99)
+    if isNewKey {
+        t.Errorf("overwriting a key already in the bucket should not report isNewKey")
+    }
+    if v, _ := n.lookup(hash, 0, "a"); v != 99 {
+        t.Errorf("updated value didn't stick: %v", v)
+    }
+
+    // deleting down to a single entry collapses the bucket back to a leaf
+    n, found := n.delete(hash, 0, "a")
+    if !found {
+        t.Fatalf("deleting a present key should report found")
+    }
+    if _, ok := n.(*leaf); !ok {
+        t.Fatalf("expected deletion to collapse the bucket to a *leaf, got %T", n)
+    }
+
+    // deleting the last entry empties the subtree
+    n, found = n.delete(hash, 0, "b")
+    if !found {
+        t.Fatalf("deleting the last entry should report found")
+    }
+    if n != nil {
+        t.Fatalf("expected a nil node after deleting the last entry, got %T", n)
+    }
+}
+
+// TestTransientMapRoundTrip checks that editing a draft never mutates
+// the source map and that every edit made through the draft shows up
+// in the Map returned by Persistent.
+func TestTransientMapRoundTrip(t *testing.T) {
+    m := NewMap().Set("a", 1).Set("b", 2)
+
+    draft := m.AsTransient()
+    draft.Set("c", 3)
+    draft.Delete("a")
+    out := draft.Persistent()
+
+    if size := m.Size(); size != 2 {
+        t.Errorf("source map was mutated: size %d", size)
+    }
+    if _, ok := m.Lookup("c"); ok {
+        t.Errorf("source map picked up a key added through the draft")
+    }
+    if v, ok := m.Lookup("a"); !ok || v != 1 {
+        t.Errorf("source map lost a key deleted through the draft: %v %v", v, ok)
+    }
+
+    if size := out.Size(); size != 2 {
+        t.Errorf("wrong size after Persistent(): %d", size)
+    }
+    if v, ok := out.Lookup("c"); !ok || v != 3 {
+        t.Errorf("missing or wrong value for c: %v %v", v, ok)
+    }
+    if _, ok := out.Lookup("a"); ok {
+        t.Errorf("a should have been deleted in the persisted map")
+    }
+}
+
+// TestTransientMapOwnerReuse confirms that successive edits within the
+// same transient reuse nodes already tagged with its owner token
+// instead of path-copying them again.
+func TestTransientMapOwnerReuse(t *testing.T) {
+    m := NewMap()
+    for i := 0; i < 50; i++ {
+        m = m.Set(fmt.Sprintf("key-%d", i), i)
+    }
+
+    draft := m.AsTransient()
+    draft.Set("key-0", "first")
+    rootAfterFirst, ok := draft.root.(*branch)
+    if !ok {
+        t.Fatalf("expected root to be a *branch, got %T", draft.root)
+    }
+
+    draft.Set("key-1", "second")
+    rootAfterSecond, ok := draft.root.(*branch)
+    if !ok {
+        t.Fatalf("expected root to be a *branch, got %T", draft.root)
+    }
+
+    if rootAfterFirst != rootAfterSecond {
+        t.Errorf("second Set within the same transient cloned the root instead of reusing the owned node")
+    }
+}
+
+// TestTransientMapIndependence confirms that two transients drafted
+// from the same source clone rather than share nodes, so their edits
+// don't leak into each other or into the source.
+func TestTransientMapIndependence(t *testing.T) {
+    m := NewMap()
+    for i := 0; i < 50; i++ {
+        m = m.Set(fmt.Sprintf("key-%d", i), i)
+    }
+
+    d1 := m.AsTransient()
+    d2 := m.AsTransient()
+    d1.Set("key-0", "from-d1")
+    d2.Set("key-0", "from-d2")
+
+    out1 := d1.Persistent()
+    out2 := d2.Persistent()
+
+    if v, _ := out1.Lookup("key-0"); v != "from-d1" {
+        t.Errorf("d1's edit was lost or overwritten: %v", v)
+    }
+    if v, _ := out2.Lookup("key-0"); v != "from-d2" {
+        t.Errorf("d2's edit was lost or overwritten: %v", v)
+    }
+    if v, _ := m.Lookup("key-0"); v != 0 {
+        t.Errorf("source map was mutated by a transient: %v", v)
+    }
+}
+
+// TestTransientMapUseAfterPersistent checks that Set/Delete/Lookup/
+// Size all refuse to operate on a draft once it's been finalized.
+func TestTransientMapUseAfterPersistent(t *testing.T) {
+    draft := NewMap().AsTransient()
+    draft.Persistent()
+
+    calls := map[string]func(){
+        "Set":    func() { draft.Set("x", 1) },
+        "Delete": func() { draft.Delete("x") },
+        "Lookup": func() { draft.Lookup("x") },
+        "Size":   func() { draft.Size() },
+    }
+    for name, call := range calls {
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf("%s on a finalized TransientMap should panic", name)
+                }
+            }()
+            call()
+        }()
+    }
+}
+
+// TestMergeAndFromMap checks that FromMap builds a Map matching its
+// source and that Merge combines two maps, resolving overlapping keys
+// and leaving both inputs untouched.
+func TestMergeAndFromMap(t *testing.T) {
+    a := NewMap().Set("x", 1).Set("y", 2)
+    b := FromMap(map[string]Any{"y": 20, "z": 3})
+
+    if size := b.Size(); size != 2 {
+        t.Fatalf("FromMap produced the wrong size: %d", size)
+    }
+    if v, ok := b.Lookup("z"); !ok || v != 3 {
+        t.Errorf("FromMap lost a key: %v %v", v, ok)
+    }
+
+    merged := a.Merge(b, func(key string, av, bv Any) Any {
+        return av.(int) + bv.(int)
+    })
+
+    if size := merged.Size(); size != 3 {
+        t.Fatalf("wrong merged size: %d", size)
+    }
+    if v, _ := merged.Lookup("x"); v != 1 {
+        t.Errorf("wrong value for x: %v", v)
+    }
+    if v, _ := merged.Lookup("y"); v != 22 {
+        t.Errorf("overlapping key wasn't resolved: %v", v)
+    }
+    if v, _ := merged.Lookup("z"); v != 3 {
+        t.Errorf("wrong value for z: %v", v)
+    }
+
+    if v, _ := a.Lookup("y"); v != 2 {
+        t.Errorf("Merge mutated its receiver: %v", v)
+    }
+    if v, _ := b.Lookup("y"); v != 20 {
+        t.Errorf("Merge mutated its argument: %v", v)
+    }
+}
+
 func BenchmarkMapSet(b *testing.B) {
     m := NewMap()
     for i := 0; i < b.N; i++ {
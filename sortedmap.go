@@ -0,0 +1,359 @@
+package ps
+
+import . "fmt"
+
+import "bytes"
+import "iter"
+import "math/rand"
+
+// A SortedMap associates unique keys (type string) with values (type
+// Any), like a Map, but additionally keeps its keys in sorted order
+// so that in-order iteration and range queries don't need a separate
+// sort step.
+type SortedMap interface {
+    // IsNil returns true if the SortedMap is empty
+    IsNil() bool
+
+    // Set returns a new SortedMap in which key and value are
+    // associated.  If the key didn't exist before, it's created;
+    // otherwise, the associated value is changed.
+    // This operation is O(log N) in the number of keys.
+    Set(key string, value Any) SortedMap
+
+    // Delete returns a new SortedMap with the association for key, if
+    // any, removed.
+    // This operation is O(log N) in the number of keys.
+    Delete(key string) SortedMap
+
+    // Lookup returns the value associated with a key, if any.  If the
+    // key exists, the second return value is true; otherwise, false.
+    // This operation is O(log N) in the number of keys.
+    Lookup(key string) (Any, bool)
+
+    // Size returns the number of key value pairs in the SortedMap.
+    // This takes O(1) time.
+    Size() int
+
+    // Keys returns a slice with all keys in this SortedMap, in
+    // ascending order.
+    Keys() []string
+
+    // Iter returns a Seq2 over every key/value pair in ascending key
+    // order.  Ranging stops as soon as the consumer of the Seq2 stops
+    // ranging.
+    Iter() iter.Seq2[string, Any]
+
+    // Range returns a Seq2 over every key/value pair whose key falls
+    // in [lo, hi], in ascending key order.  This operation is
+    // O(log N + k) for a result of k pairs.
+    Range(lo, hi string) iter.Seq2[string, Any]
+
+    // Min returns the association with the smallest key.  The third
+    // return value is false if the SortedMap is empty.
+    Min() (string, Any, bool)
+
+    // Max returns the association with the largest key.  The third
+    // return value is false if the SortedMap is empty.
+    Max() (string, Any, bool)
+
+    // SubMap returns a SortedMap holding only the associations whose
+    // key falls in [lo, hi].
+    SubMap(lo, hi string) SortedMap
+
+    String() string
+}
+
+// Immutable (i.e. persistent) treap, keyed and ordered by key rather
+// than by hashKey(key).  Balance comes from priority, a value chosen
+// at random when a key is first inserted: a node may never have a
+// child with a higher priority, which keeps the tree balanced with
+// high probability regardless of insertion order.
+type treap struct {
+    count    int
+    key      string
+    value    Any
+    priority uint64
+    left     *treap
+    right    *treap
+}
+var nilTreap = &treap{}
+
+// Recursively set nilTreap's subtrees to point at itself, exactly as
+// nilMap does for tree, so treap code never has to check for a plain
+// nil pointer.
+func init() {
+    nilTreap.left = nilTreap
+    nilTreap.right = nilTreap
+}
+
+// NewSortedMap allocates a new, persistent, key-ordered map from
+// strings to values of any type.
+// This is currently implemented as a treap.
+func NewSortedMap() SortedMap {
+    return nilTreap
+}
+
+func (self *treap) IsNil() bool {
+    return self == nilTreap
+}
+
+// clone returns an exact duplicate of a treap node
+func (self *treap) clone() *treap {
+    var t treap
+    t.count    = self.count
+    t.key      = self.key
+    t.value    = self.value
+    t.priority = self.priority
+    t.left     = self.left
+    t.right    = self.right
+    return &t
+}
+
+// recalcCount recomputes a node's key count from the counts of its
+// subtrees, the treap equivalent of tree's recalculateCount.
+func (self *treap) recalcCount() {
+    count := 1
+    if !self.left.IsNil() {
+        count += self.left.count
+    }
+    if !self.right.IsNil() {
+        count += self.right.count
+    }
+    self.count = count
+}
+
+// rotateRight brings self's left child up to the root, preserving BST
+// order.  self must already be a fresh node private to this
+// operation; its left child, being shared with the source tree, is
+// cloned.
+func rotateRight(self *treap) *treap {
+    pivot := self.left.clone()
+    self.left = pivot.right
+    self.recalcCount()
+    pivot.right = self
+    pivot.recalcCount()
+    return pivot
+}
+
+// rotateLeft is rotateRight's mirror image.
+func rotateLeft(self *treap) *treap {
+    pivot := self.right.clone()
+    self.right = pivot.left
+    self.recalcCount()
+    pivot.left = self
+    pivot.recalcCount()
+    return pivot
+}
+
+func (self *treap) Set(key string, value Any) SortedMap {
+    return treapSet(self, key, value)
+}
+
+func treapSet(self *treap, key string, value Any) *treap {
+    if self.IsNil() {
+        n := self.clone()
+        n.count = 1
+        n.key = key
+        n.value = value
+        n.priority = rand.Uint64()
+        return n
+    }
+
+    n := self.clone()
+    switch {
+    case key < self.key:
+        n.left = treapSet(self.left, key, value)
+        n.recalcCount()
+        if n.left.priority > n.priority {
+            n = rotateRight(n)
+        }
+    case key > self.key:
+        n.right = treapSet(self.right, key, value)
+        n.recalcCount()
+        if n.right.priority > n.priority {
+            n = rotateLeft(n)
+        }
+    default:
+        n.value = value
+    }
+    return n
+}
+
+func (self *treap) Delete(key string) SortedMap {
+    newRoot, found := treapDelete(self, key)
+    if !found {
+        return self
+    }
+    return newRoot
+}
+
+func treapDelete(self *treap, key string) (*treap, bool) {
+    if self.IsNil() {
+        return self, false
+    }
+
+    switch {
+    case key < self.key:
+        newLeft, found := treapDelete(self.left, key)
+        if !found {
+            return self, false
+        }
+        n := self.clone()
+        n.left = newLeft
+        n.recalcCount()
+        return n, true
+    case key > self.key:
+        newRight, found := treapDelete(self.right, key)
+        if !found {
+            return self, false
+        }
+        n := self.clone()
+        n.right = newRight
+        n.recalcCount()
+        return n, true
+    }
+
+    return treapRemoveRoot(self), true
+}
+
+// treapRemoveRoot removes self's own key, rotating the higher
+// priority child up until self becomes a leaf.
+func treapRemoveRoot(self *treap) *treap {
+    if self.left.IsNil() {
+        return self.right
+    }
+    if self.right.IsNil() {
+        return self.left
+    }
+
+    if self.left.priority > self.right.priority {
+        rotated := rotateRight(self.clone())
+        rotated.right = treapRemoveRoot(rotated.right)
+        rotated.recalcCount()
+        return rotated
+    }
+    rotated := rotateLeft(self.clone())
+    rotated.left = treapRemoveRoot(rotated.left)
+    rotated.recalcCount()
+    return rotated
+}
+
+func (self *treap) Lookup(key string) (Any, bool) {
+    if self.IsNil() {
+        return nil, false
+    }
+    switch {
+    case key < self.key:
+        return self.left.Lookup(key)
+    case key > self.key:
+        return self.right.Lookup(key)
+    }
+    return self.value, true
+}
+
+func (self *treap) Size() int {
+    return self.count
+}
+
+func (self *treap) Keys() []string {
+    keys := make([]string, 0, self.Size())
+    for key := range self.Iter() {
+        keys = append(keys, key)
+    }
+    return keys
+}
+
+// Iter returns a Seq2 over self's key/value pairs, in ascending key
+// order.
+func (self *treap) Iter() iter.Seq2[string, Any] {
+    return func(yield func(string, Any) bool) {
+        self.walk(yield)
+    }
+}
+
+// walk visits self's key/value pairs in ascending key order, stopping
+// and returning false as soon as yield does.
+func (self *treap) walk(yield func(string, Any) bool) bool {
+    if self.IsNil() {
+        return true
+    }
+    if !self.left.walk(yield) {
+        return false
+    }
+    if !yield(self.key, self.value) {
+        return false
+    }
+    return self.right.walk(yield)
+}
+
+// Range returns a Seq2 over every association whose key falls in
+// [lo, hi], in ascending key order.
+func (self *treap) Range(lo, hi string) iter.Seq2[string, Any] {
+    return func(yield func(string, Any) bool) {
+        self.walkRange(lo, hi, yield)
+    }
+}
+
+func (self *treap) walkRange(lo, hi string, yield func(string, Any) bool) bool {
+    if self.IsNil() {
+        return true
+    }
+    if self.key > lo {
+        if !self.left.walkRange(lo, hi, yield) {
+            return false
+        }
+    }
+    if self.key >= lo && self.key <= hi {
+        if !yield(self.key, self.value) {
+            return false
+        }
+    }
+    if self.key < hi {
+        if !self.right.walkRange(lo, hi, yield) {
+            return false
+        }
+    }
+    return true
+}
+
+func (self *treap) Min() (string, Any, bool) {
+    if self.IsNil() {
+        return "", nil, false
+    }
+    n := self
+    for !n.left.IsNil() {
+        n = n.left
+    }
+    return n.key, n.value, true
+}
+
+func (self *treap) Max() (string, Any, bool) {
+    if self.IsNil() {
+        return "", nil, false
+    }
+    n := self
+    for !n.right.IsNil() {
+        n = n.right
+    }
+    return n.key, n.value, true
+}
+
+// SubMap returns a SortedMap holding only the associations whose key
+// falls in [lo, hi].
+func (self *treap) SubMap(lo, hi string) SortedMap {
+    sub := NewSortedMap()
+    for key, value := range self.Range(lo, hi) {
+        sub = sub.Set(key, value)
+    }
+    return sub
+}
+
+// make it easier to display SortedMaps for debugging
+func (self *treap) String() string {
+    buf := bytes.NewBufferString("{")
+    for key, val := range self.Iter() {
+        Fprintf(buf, "%s: %s, ", key, val)
+    }
+    Fprintf(buf, "}\n")
+    return buf.String()
+}
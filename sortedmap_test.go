@@ -0,0 +1,64 @@
+package ps
+
+import "testing"
+
+func TestSortedMapOrder(t *testing.T) {
+    m := NewSortedMap().Set("banana", 2).Set("apple", 1).Set("cherry", 3)
+
+    // Iter visits keys in ascending order
+    var keys []string
+    for k := range m.Iter() {
+        keys = append(keys, k)
+    }
+    if len(keys) != 3 || keys[0] != "apple" || keys[1] != "banana" || keys[2] != "cherry" {
+        t.Errorf("Iter() returned keys out of order: %#v", keys)
+    }
+
+    // Lookup finds every key
+    if v, ok := m.Lookup("banana"); !ok || v != 2 {
+        t.Errorf("Lookup(banana) = %v, %v", v, ok)
+    }
+
+    // Min and Max
+    if k, v, ok := m.Min(); !ok || k != "apple" || v != 1 {
+        t.Errorf("Min() = %v, %v, %v", k, v, ok)
+    }
+    if k, v, ok := m.Max(); !ok || k != "cherry" || v != 3 {
+        t.Errorf("Max() = %v, %v, %v", k, v, ok)
+    }
+
+    // Delete removes a key without disturbing the others
+    without := m.Delete("banana")
+    if _, ok := without.Lookup("banana"); ok {
+        t.Errorf("Delete(banana) left banana behind")
+    }
+    if without.Size() != 2 {
+        t.Errorf("Delete(banana) size is %d, expected 2", without.Size())
+    }
+    if _, ok := m.Lookup("banana"); !ok {
+        t.Errorf("Delete() modified the receiving SortedMap")
+    }
+}
+
+func TestSortedMapRange(t *testing.T) {
+    m := NewSortedMap()
+    for _, k := range []string{"a", "b", "c", "d", "e"} {
+        m = m.Set(k, k)
+    }
+
+    var keys []string
+    for k := range m.Range("b", "d") {
+        keys = append(keys, k)
+    }
+    if len(keys) != 3 || keys[0] != "b" || keys[1] != "c" || keys[2] != "d" {
+        t.Errorf("Range(b, d) returned %#v", keys)
+    }
+
+    sub := m.SubMap("b", "d")
+    if sub.Size() != 3 {
+        t.Errorf("SubMap(b, d) size is %d, expected 3", sub.Size())
+    }
+    if _, ok := sub.Lookup("a"); ok {
+        t.Errorf("SubMap(b, d) kept a key outside the range")
+    }
+}